@@ -0,0 +1,88 @@
+// Package input defines the data structures that represent a request as
+// parsed from the command line, before it is turned into an *http.Request.
+package input
+
+import "net/url"
+
+// Method is an HTTP method such as GET, POST, PUT, ...
+type Method string
+
+// Field is a single name/value pair taken from the command line, e.g.
+// "foo=bar" or "foo=@file.txt". When IsFile is true, Value holds the path
+// to a file whose contents should be substituted for the field's value.
+type Field struct {
+	Name   string
+	Value  string
+	IsFile bool
+}
+
+// Header holds the header fields specified on the command line.
+type Header struct {
+	Fields []Field
+}
+
+// BodyType selects how Body.Fields (and Body.RawJsonFields) are encoded
+// into the request body.
+type BodyType int
+
+const (
+	// EmptyBody means that the request has no body at all.
+	EmptyBody BodyType = iota
+
+	// JsonBody means that Fields and RawJsonFields are encoded as a JSON
+	// object.
+	JsonBody
+
+	// FormBody means that Fields are encoded as
+	// application/x-www-form-urlencoded.
+	FormBody
+
+	// MultipartFormBody means that Fields are encoded as
+	// multipart/form-data, which is required to upload files. A FormBody
+	// containing a file field is auto-promoted to MultipartFormBody even
+	// if this value is never selected explicitly.
+	MultipartFormBody
+
+	// RawBody means that the body is read verbatim from RawSource instead
+	// of being assembled from Fields, e.g. "httpie-go POST /x @payload.json".
+	RawBody
+)
+
+// Body holds the data needed to build the request body.
+type Body struct {
+	BodyType BodyType
+
+	// Fields are encoded as plain strings (":=" is not used on the
+	// command line for these).
+	Fields []Field
+
+	// RawJsonFields are only used when BodyType is JsonBody. Each
+	// Value is a JSON fragment (e.g. "true", "[1, 2]") that is embedded
+	// verbatim rather than being treated as a string.
+	//
+	// Note: Fields and RawJsonFields are applied to the JSON body as two
+	// separate passes (all of Fields, then all of RawJsonFields), not
+	// interleaved in the order the user actually typed them. This only
+	// matters for bracket-path array appends ("a[]=..."): mixing plain
+	// and raw-JSON appends into the same array groups them by kind
+	// rather than by original position.
+	RawJsonFields []Field
+
+	// RawSource is only used when BodyType is RawBody. It names the file
+	// to read the whole body from, or "-" to read it from stdin.
+	RawSource string
+
+	// RawContentType is only used when BodyType is RawBody. When set, it
+	// takes precedence over sniffing the Content-Type from RawSource.
+	RawContentType string
+}
+
+// Request is the fully-parsed representation of a single HTTP request,
+// ready to be handed to request.Build.
+type Request struct {
+	Method     Method
+	URL        *url.URL
+	Parameters []Field
+	Header     Header
+	Body       Body
+}
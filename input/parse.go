@@ -0,0 +1,28 @@
+package input
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseBodyTokens recognizes HTTPie's whole-body syntax: a single "@source"
+// token (and no other field tokens) selects RawBody, reading the entire
+// body from the named file, or from stdin when source is "-". It returns
+// ok=false when tokens don't match this form, so the caller can fall back
+// to field-by-field parsing (":=" / "==" / "@file" field tokens) instead.
+//
+// This only covers recognizing the token shape; wiring it up to actual
+// argv/flag parsing belongs to the command-line entry point, which does
+// not exist yet in this tree.
+func ParseBodyTokens(tokens []string) (Body, bool, error) {
+	if len(tokens) != 1 || !strings.HasPrefix(tokens[0], "@") {
+		return Body{}, false, nil
+	}
+
+	source := strings.TrimPrefix(tokens[0], "@")
+	if source == "" {
+		return Body{}, false, fmt.Errorf("invalid raw body token %q: missing file name after '@'", tokens[0])
+	}
+
+	return Body{BodyType: RawBody, RawSource: source}, true, nil
+}
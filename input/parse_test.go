@@ -0,0 +1,60 @@
+package input
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseBodyTokens(t *testing.T) {
+	testCases := []struct {
+		name       string
+		tokens     []string
+		expectBody Body
+		expectOk   bool
+		expectErr  bool
+	}{
+		{
+			name:       "raw body from file",
+			tokens:     []string{"@payload.json"},
+			expectBody: Body{BodyType: RawBody, RawSource: "payload.json"},
+			expectOk:   true,
+		},
+		{
+			name:       "raw body from stdin",
+			tokens:     []string{"@-"},
+			expectBody: Body{BodyType: RawBody, RawSource: "-"},
+			expectOk:   true,
+		},
+		{
+			name:     "ordinary field token is not a raw body",
+			tokens:   []string{"foo=bar"},
+			expectOk: false,
+		},
+		{
+			name:     "multiple tokens are not a whole-body form",
+			tokens:   []string{"@payload.json", "foo=bar"},
+			expectOk: false,
+		},
+		{
+			name:      "bare @ with no file name is an error",
+			tokens:    []string{"@"},
+			expectOk:  false,
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			body, ok, err := ParseBodyTokens(tc.tokens)
+			if (err != nil) != tc.expectErr {
+				t.Fatalf("unexpected error state: err=%v, expectErr=%v", err, tc.expectErr)
+			}
+			if ok != tc.expectOk {
+				t.Fatalf("unexpected ok: expected=%v, actual=%v", tc.expectOk, ok)
+			}
+			if tc.expectOk && !reflect.DeepEqual(body, tc.expectBody) {
+				t.Errorf("unexpected body: expected=%+v, actual=%+v", tc.expectBody, body)
+			}
+		})
+	}
+}
@@ -0,0 +1,542 @@
+// Package request turns an input.Request, as produced by the command line
+// parser, into a ready-to-send *http.Request.
+package request
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/nojima/httpie-go/input"
+)
+
+const userAgent = "httpie-go/0.0.0"
+
+// bodyTuple bundles together everything buildHttpRequest needs to attach a
+// body to an *http.Request: the reader to stream it from, its declared
+// content type and its length.
+type bodyTuple struct {
+	body          io.Reader
+	contentType   string
+	contentLength int64
+
+	// getBody, when set, becomes the built request's GetBody: a factory
+	// for a fresh copy of the body so the net/http client can resend it
+	// after a redirect. In-memory bodies get this for free from
+	// http.NewRequest; file-backed bodies that can't simply be re-read
+	// (e.g. an already-consumed stdin) leave this nil.
+	getBody func() (io.ReadCloser, error)
+}
+
+// Build converts request into an *http.Request that can be passed to an
+// http.Client.
+func Build(request *input.Request) (*http.Request, error) {
+	return buildHttpRequest(request)
+}
+
+func buildHttpRequest(request *input.Request) (*http.Request, error) {
+	header, err := buildHttpHeader(request)
+	if err != nil {
+		return nil, err
+	}
+	header.Set("User-Agent", userAgent)
+
+	// Resolve the URL before opening the body: buildHttpBody may leave an
+	// open file (or an unlinked stdin temp file) behind, and we don't want
+	// to leak it if building the URL fails afterwards.
+	u, err := buildURL(request)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := buildHttpBody(request)
+	if err != nil {
+		return nil, err
+	}
+	if body.contentType != "" {
+		header.Set("Content-Type", body.contentType)
+	}
+
+	var bodyReader io.Reader
+	if body.body != nil {
+		bodyReader = body.body
+	}
+	req, err := http.NewRequest(string(request.Method), u.String(), bodyReader)
+	if err != nil {
+		closeBody(body)
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header = header
+	if body.contentLength > 0 {
+		req.ContentLength = body.contentLength
+	}
+	if body.getBody != nil {
+		req.GetBody = body.getBody
+	}
+
+	// A "Host" header is special-cased by net/http: it is not sent as a
+	// regular header but used to fill in the request line and the Host
+	// field of the request. Since the user may have supplied it as an
+	// ordinary header field, propagate it to both the URL and Request.Host.
+	if host := header.Get("Host"); host != "" {
+		req.Host = host
+		req.URL.Host = host
+	}
+
+	return req, nil
+}
+
+// closeBody releases a body opened by buildHttpBody (e.g. a file) when the
+// request can't be built after all.
+func closeBody(body bodyTuple) {
+	if c, ok := body.body.(io.Closer); ok {
+		c.Close()
+	}
+}
+
+func buildURL(request *input.Request) (*url.URL, error) {
+	u := *request.URL
+	query := u.Query()
+	for _, field := range request.Parameters {
+		value, err := fieldValue(field)
+		if err != nil {
+			return nil, err
+		}
+		query.Add(field.Name, value)
+	}
+	u.RawQuery = query.Encode()
+	return &u, nil
+}
+
+func buildHttpHeader(request *input.Request) (http.Header, error) {
+	header := http.Header{}
+
+	for _, field := range request.Header.Fields {
+		value, err := fieldValue(field)
+		if err != nil {
+			return nil, err
+		}
+		header.Add(field.Name, value)
+	}
+
+	return header, nil
+}
+
+func buildHttpBody(request *input.Request) (bodyTuple, error) {
+	switch request.Body.BodyType {
+	case input.EmptyBody:
+		return bodyTuple{}, nil
+	case input.JsonBody:
+		return buildJsonBody(request.Body)
+	case input.FormBody:
+		if hasFileField(request.Body.Fields) {
+			return buildMultipartFormBody(request.Body)
+		}
+		return buildFormBody(request.Body)
+	case input.MultipartFormBody:
+		return buildMultipartFormBody(request.Body)
+	case input.RawBody:
+		return buildRawBody(request.Body)
+	default:
+		return bodyTuple{}, fmt.Errorf("unknown body type: %v", request.Body.BodyType)
+	}
+}
+
+// buildJsonBody applies body.Fields and then body.RawJsonFields, in that
+// order. See the note on input.Body.RawJsonFields: this means a bracket-path
+// array ("a[]=...") built from both kinds is grouped by kind rather than by
+// the order the user actually typed the fields in.
+func buildJsonBody(body input.Body) (bodyTuple, error) {
+	obj := map[string]interface{}{}
+
+	for _, field := range body.Fields {
+		value, err := fieldValue(field)
+		if err != nil {
+			return bodyTuple{}, err
+		}
+		if err := setJsonPath(obj, field.Name, value); err != nil {
+			return bodyTuple{}, err
+		}
+	}
+
+	for _, field := range body.RawJsonFields {
+		if !json.Valid([]byte(field.Value)) {
+			return bodyTuple{}, fmt.Errorf("invalid JSON in field %q: %s", field.Name, field.Value)
+		}
+		if err := setJsonPath(obj, field.Name, json.RawMessage(field.Value)); err != nil {
+			return bodyTuple{}, err
+		}
+	}
+
+	encoded, err := json.Marshal(obj)
+	if err != nil {
+		return bodyTuple{}, fmt.Errorf("failed to encode JSON body: %w", err)
+	}
+
+	return bodyTuple{
+		body:          bytes.NewReader(encoded),
+		contentType:   "application/json",
+		contentLength: int64(len(encoded)),
+	}, nil
+}
+
+// jsonPathSegment is one step of a bracket-path field name such as
+// "user[tags][]": a bare identifier or "[name]" selects an object key,
+// "[]" appends to an array, and "[N]" sets an array index.
+type jsonPathSegment struct {
+	key      string
+	index    int
+	hasIndex bool
+	isAppend bool
+}
+
+// parseJsonPath splits a field name like "user[tags][0]" into the segments
+// ["user", "tags", index 0]. The first segment is always a bare object key.
+func parseJsonPath(name string) ([]jsonPathSegment, error) {
+	bracket := strings.IndexByte(name, '[')
+	var head string
+	if bracket == -1 {
+		head, bracket = name, len(name)
+	} else {
+		head = name[:bracket]
+	}
+	if head == "" {
+		return nil, fmt.Errorf("invalid field name %q: missing leading key", name)
+	}
+	segments := []jsonPathSegment{{key: head}}
+
+	for i := bracket; i < len(name); {
+		if name[i] != '[' {
+			return nil, fmt.Errorf("invalid field name %q: expected '[' at position %d", name, i)
+		}
+		end := strings.IndexByte(name[i:], ']')
+		if end == -1 {
+			return nil, fmt.Errorf("invalid field name %q: unterminated '['", name)
+		}
+		end += i
+		inner := name[i+1 : end]
+		switch {
+		case inner == "":
+			segments = append(segments, jsonPathSegment{isAppend: true})
+		default:
+			if n, err := strconv.Atoi(inner); err == nil && n >= 0 {
+				segments = append(segments, jsonPathSegment{index: n, hasIndex: true})
+			} else {
+				segments = append(segments, jsonPathSegment{key: inner})
+			}
+		}
+		i = end + 1
+	}
+	return segments, nil
+}
+
+// setJsonPath assigns value into root at the path named by name, creating
+// intermediate objects and arrays as needed. It reports a conflict error,
+// naming the offending field, when the same path is used as both a
+// container and a leaf, or as both an object and an array.
+func setJsonPath(root map[string]interface{}, name string, value interface{}) error {
+	segments, err := parseJsonPath(name)
+	if err != nil {
+		return err
+	}
+	first := segments[0]
+	child, err := applyJsonPath(root[first.key], segments[1:], value, name)
+	if err != nil {
+		return err
+	}
+	root[first.key] = child
+	return nil
+}
+
+func isJsonContainer(v interface{}) bool {
+	switch v.(type) {
+	case map[string]interface{}, []interface{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func jsonPathConflict(name string) error {
+	return fmt.Errorf("conflicting shape for JSON body field %q", name)
+}
+
+// applyJsonPath returns the value that current should be replaced with
+// after walking the remaining path segments and assigning value at the leaf.
+func applyJsonPath(current interface{}, segments []jsonPathSegment, value interface{}, name string) (interface{}, error) {
+	if len(segments) == 0 {
+		if isJsonContainer(current) {
+			return nil, jsonPathConflict(name)
+		}
+		return value, nil
+	}
+
+	seg := segments[0]
+	switch {
+	case seg.isAppend:
+		arr, ok := current.([]interface{})
+		if current != nil && !ok {
+			return nil, jsonPathConflict(name)
+		}
+		elem, err := applyJsonPath(nil, segments[1:], value, name)
+		if err != nil {
+			return nil, err
+		}
+		return append(arr, elem), nil
+
+	case seg.hasIndex:
+		arr, ok := current.([]interface{})
+		if current != nil && !ok {
+			return nil, jsonPathConflict(name)
+		}
+		for len(arr) <= seg.index {
+			arr = append(arr, nil)
+		}
+		elem, err := applyJsonPath(arr[seg.index], segments[1:], value, name)
+		if err != nil {
+			return nil, err
+		}
+		arr[seg.index] = elem
+		return arr, nil
+
+	default:
+		m, ok := current.(map[string]interface{})
+		if current != nil && !ok {
+			return nil, jsonPathConflict(name)
+		}
+		if m == nil {
+			m = map[string]interface{}{}
+		}
+		elem, err := applyJsonPath(m[seg.key], segments[1:], value, name)
+		if err != nil {
+			return nil, err
+		}
+		m[seg.key] = elem
+		return m, nil
+	}
+}
+
+func buildFormBody(body input.Body) (bodyTuple, error) {
+	values := url.Values{}
+
+	for _, field := range body.Fields {
+		value, err := fieldValue(field)
+		if err != nil {
+			return bodyTuple{}, err
+		}
+		values.Add(field.Name, value)
+	}
+
+	encoded := values.Encode()
+
+	return bodyTuple{
+		body:          bytes.NewReader([]byte(encoded)),
+		contentType:   "application/x-www-form-urlencoded; charset=utf-8",
+		contentLength: int64(len(encoded)),
+	}, nil
+}
+
+func hasFileField(fields []input.Field) bool {
+	for _, field := range fields {
+		if field.IsFile {
+			return true
+		}
+	}
+	return false
+}
+
+// buildMultipartFormBody encodes body as multipart/form-data, the mode
+// required to actually upload file contents rather than inlining them as
+// form values.
+func buildMultipartFormBody(body input.Body) (bodyTuple, error) {
+	buf := &bytes.Buffer{}
+	w := multipart.NewWriter(buf)
+
+	for _, field := range body.Fields {
+		if field.IsFile {
+			if err := writeMultipartFile(w, field); err != nil {
+				return bodyTuple{}, err
+			}
+			continue
+		}
+		fw, err := w.CreateFormField(field.Name)
+		if err != nil {
+			return bodyTuple{}, fmt.Errorf("failed to create form field %q: %w", field.Name, err)
+		}
+		if _, err := fw.Write([]byte(field.Value)); err != nil {
+			return bodyTuple{}, fmt.Errorf("failed to write form field %q: %w", field.Name, err)
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		return bodyTuple{}, fmt.Errorf("failed to finalize multipart body: %w", err)
+	}
+
+	return bodyTuple{
+		body:          bytes.NewReader(buf.Bytes()),
+		contentType:   w.FormDataContentType(),
+		contentLength: int64(buf.Len()),
+	}, nil
+}
+
+func writeMultipartFile(w *multipart.Writer, field input.Field) error {
+	f, err := os.Open(field.Value)
+	if err != nil {
+		return fmt.Errorf("failed to open file %q: %w", field.Value, err)
+	}
+	defer f.Close()
+
+	contentType, err := detectContentType(f, "")
+	if err != nil {
+		return fmt.Errorf("failed to detect content type of file %q: %w", field.Value, err)
+	}
+
+	part, err := createFormFile(w, field.Name, filepath.Base(field.Value), contentType)
+	if err != nil {
+		return fmt.Errorf("failed to create form file %q: %w", field.Name, err)
+	}
+	if _, err := io.Copy(part, f); err != nil {
+		return fmt.Errorf("failed to copy file %q into request body: %w", field.Value, err)
+	}
+	return nil
+}
+
+// quoteEscaper mirrors the unexported replacer mime/multipart uses when
+// quoting field and file names, so our hand-rolled CreateFormFile matches
+// the stdlib's own escaping.
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// createFormFile is multipart.Writer.CreateFormFile with the content type
+// overridden by the caller instead of being hard-coded to
+// application/octet-stream, so that sniffed file types are preserved.
+func createFormFile(w *multipart.Writer, fieldname, filename, contentType string) (io.Writer, error) {
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition", fmt.Sprintf(
+		`form-data; name="%s"; filename="%s"`,
+		quoteEscaper.Replace(fieldname), quoteEscaper.Replace(filename)))
+	h.Set("Content-Type", contentType)
+	return w.CreatePart(h)
+}
+
+const sniffPrefixLength = 512
+
+// buildRawBody reads the whole request body from body.RawSource, streaming
+// it from disk rather than slurping it into memory so large uploads work.
+func buildRawBody(body input.Body) (bodyTuple, error) {
+	if body.RawSource == "-" {
+		return buildRawBodyFromStdin(body.RawContentType)
+	}
+	return buildRawBodyFromFile(body.RawSource, body.RawContentType)
+}
+
+func buildRawBodyFromFile(path, contentTypeOverride string) (bodyTuple, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return bodyTuple{}, fmt.Errorf("failed to open request body file %q: %w", path, err)
+	}
+
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return bodyTuple{}, fmt.Errorf("failed to stat request body file %q: %w", path, err)
+	}
+
+	contentType, err := detectContentType(f, contentTypeOverride)
+	if err != nil {
+		f.Close()
+		return bodyTuple{}, fmt.Errorf("failed to detect content type of %q: %w", path, err)
+	}
+
+	return bodyTuple{
+		body:          f,
+		contentType:   contentType,
+		contentLength: stat.Size(),
+		getBody: func() (io.ReadCloser, error) {
+			return os.Open(path)
+		},
+	}, nil
+}
+
+// buildRawBodyFromStdin buffers stdin into a temporary file so that, unlike
+// a true stream, its size is known up front: many HTTP/1.1 servers reject
+// chunked request bodies. The directory entry is unlinked immediately after
+// writing; the already-open file descriptor keeps working until it is
+// closed once the request has been sent.
+func buildRawBodyFromStdin(contentTypeOverride string) (bodyTuple, error) {
+	tmp, err := ioutil.TempFile("", "httpie-go-stdin-")
+	if err != nil {
+		return bodyTuple{}, fmt.Errorf("failed to create temporary file for stdin body: %w", err)
+	}
+	name := tmp.Name()
+
+	if _, err := io.Copy(tmp, os.Stdin); err != nil {
+		tmp.Close()
+		os.Remove(name)
+		return bodyTuple{}, fmt.Errorf("failed to read request body from stdin: %w", err)
+	}
+	os.Remove(name)
+
+	stat, err := tmp.Stat()
+	if err != nil {
+		tmp.Close()
+		return bodyTuple{}, fmt.Errorf("failed to stat stdin body: %w", err)
+	}
+
+	// io.Copy left the cursor at EOF; rewind before sniffing or reading it
+	// back, or detectContentType will see an empty prefix.
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		tmp.Close()
+		return bodyTuple{}, fmt.Errorf("failed to rewind stdin body: %w", err)
+	}
+
+	contentType, err := detectContentType(tmp, contentTypeOverride)
+	if err != nil {
+		tmp.Close()
+		return bodyTuple{}, fmt.Errorf("failed to detect content type of stdin body: %w", err)
+	}
+
+	// No getBody here: the directory entry is already gone and stdin itself
+	// can't be re-read, so a redirect simply can't be retried with this body.
+	return bodyTuple{body: tmp, contentType: contentType, contentLength: stat.Size()}, nil
+}
+
+// detectContentType returns contentTypeOverride if it is non-empty,
+// otherwise it sniffs the content type from a prefix of f and rewinds f so
+// the whole body can still be read from the start.
+func detectContentType(f *os.File, contentTypeOverride string) (string, error) {
+	if contentTypeOverride != "" {
+		return contentTypeOverride, nil
+	}
+	prefix := make([]byte, sniffPrefixLength)
+	n, err := io.ReadFull(f, prefix)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return http.DetectContentType(prefix[:n]), nil
+}
+
+// fieldValue returns the value that a field contributes to a request: the
+// literal Value, or the contents of the file it names when IsFile is set.
+func fieldValue(field input.Field) (string, error) {
+	if !field.IsFile {
+		return field.Value, nil
+	}
+	content, err := ioutil.ReadFile(field.Value)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file %q: %w", field.Value, err)
+	}
+	return string(content), nil
+}